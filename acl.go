@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// permission is what a principal may do to a path.
+type permission int
+
+const (
+	permNone permission = iota
+	permRead
+	permWrite
+)
+
+// AclRule grants read/write access to paths under Prefix to a set of
+// principals. A principal is either a Tailscale login name
+// ("alice@github"), a node tag ("tag:kiosk"), or "*" meaning anyone.
+type AclRule struct {
+	Prefix string   `json:"prefix" yaml:"prefix"`
+	Read   []string `json:"read" yaml:"read"`
+	Write  []string `json:"write" yaml:"write"`
+}
+
+// AclPolicy is the root of the -acl policy file. FunnelAnonymous, if set,
+// is the principal assigned to requests with no resolvable Tailscale
+// identity, such as traffic coming in through Funnel.
+type AclPolicy struct {
+	Rules           []AclRule `json:"rules" yaml:"rules"`
+	FunnelAnonymous string    `json:"funnelAnonymous" yaml:"funnelAnonymous"`
+}
+
+// LoadAclPolicy reads and parses the policy file at path, as YAML if its
+// extension is .yaml or .yml and as JSON otherwise.
+func LoadAclPolicy(path string) (*AclPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy AclPolicy
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &policy); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return nil, err
+		}
+	}
+	return &policy, nil
+}
+
+func hasPrincipal(list []string, principal string) bool {
+	for _, item := range list {
+		if item == "*" || item == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns the highest permission granted to any of principals over
+// urlPath, using the longest matching Prefix among the policy's rules.
+func (p *AclPolicy) Allows(urlPath string, principals []string) permission {
+	if p == nil {
+		return permWrite
+	}
+	bestLen := -1
+	result := permNone
+	for _, rule := range p.Rules {
+		if !strings.HasPrefix(urlPath, rule.Prefix) || len(rule.Prefix) < bestLen {
+			continue
+		}
+		bestLen = len(rule.Prefix)
+		result = permNone
+		for _, principal := range principals {
+			if hasPrincipal(rule.Write, principal) {
+				result = permWrite
+				break
+			}
+			if hasPrincipal(rule.Read, principal) {
+				result = permRead
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package fileserver
+
+import "testing"
+
+func TestAclPolicyAllows(t *testing.T) {
+	policy := &AclPolicy{
+		Rules: []AclRule{
+			{Prefix: "/", Read: []string{"*"}},
+			{Prefix: "/private", Read: []string{"alice@github"}, Write: []string{"alice@github"}},
+			{Prefix: "/private/shared", Read: []string{"*"}},
+			{Prefix: "/public", Write: []string{"*"}},
+		},
+		FunnelAnonymous: "anonymous",
+	}
+
+	cases := []struct {
+		name       string
+		urlPath    string
+		principals []string
+		want       permission
+	}{
+		{"read-all matches root prefix", "/notes.txt", []string{"bob@github"}, permRead},
+		{"owner gets write on private", "/private/secret.txt", []string{"alice@github"}, permWrite},
+		{"stranger denied on private despite root read rule", "/private/secret.txt", []string{"bob@github"}, permNone},
+		{"longest prefix wins over shorter private rule", "/private/shared/readme.txt", []string{"bob@github"}, permRead},
+		{"wildcard write on public", "/public/upload.bin", []string{"anyone@github"}, permWrite},
+		{"no principals at all gets nothing, even under a wildcard rule", "/notes.txt", nil, permNone},
+		{"funnel anonymous principal gets wildcard read", "/notes.txt", []string{"anonymous"}, permRead},
+		{"funnel anonymous still bound by wildcard write rules", "/public/upload.bin", []string{"anonymous"}, permWrite},
+		{"funnel anonymous denied write where only alice can write", "/private/secret.txt", []string{"anonymous"}, permNone},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := policy.Allows(tc.urlPath, tc.principals); got != tc.want {
+				t.Fatalf("Allows(%q, %v) = %v, want %v", tc.urlPath, tc.principals, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAclPolicyAllowsNilPolicyIsPermissive(t *testing.T) {
+	var policy *AclPolicy
+	if got := policy.Allows("/anything", nil); got != permWrite {
+		t.Fatalf("Allows on a nil policy = %v, want permWrite", got)
+	}
+}
+
+func TestHasPrincipal(t *testing.T) {
+	if !hasPrincipal([]string{"*"}, "anyone@github") {
+		t.Fatal("\"*\" should match any principal")
+	}
+	if !hasPrincipal([]string{"alice@github"}, "alice@github") {
+		t.Fatal("exact match should match")
+	}
+	if hasPrincipal([]string{"alice@github"}, "bob@github") {
+		t.Fatal("non-matching principal should not match")
+	}
+	if hasPrincipal(nil, "alice@github") {
+		t.Fatal("empty list should match nothing")
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/webdav"
 	"tailscale.com/tsnet"
 )
 
@@ -23,20 +28,27 @@ type AppParams struct {
 	Name     string
 	Funnel   bool
 	Writable bool
+	Dav      bool
+	Acl      string
+	Logger   *slog.Logger
 }
 
 type app struct {
-	ctx      context.Context
-	root     string
-	cancel   func()
-	server   *tsnet.Server
-	handler  *FileServer
-	funnel   bool
-	writable bool
+	ctx        context.Context
+	root       string
+	cancel     func()
+	server     *tsnet.Server
+	handler    *FileServer
+	davHandler http.Handler
+	tusHandler *TusHandler
+	logger     *slog.Logger
+	funnel     bool
+	writable   bool
 }
 
 var (
-	ErrNotADir = errors.New("not a directory")
+	ErrNotADir       = errors.New("not a directory")
+	ErrPathTraversal = errors.New("path escapes the server root")
 )
 
 func NewApp(args AppParams) (*app, error) {
@@ -57,19 +69,52 @@ func NewApp(args AppParams) (*app, error) {
 
 	ctx, cancel := context.WithCancel(args.Ctx)
 
+	logger := args.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+
 	handler, err := NewFileServer(args.Root, args.Writable)
 	if err != nil {
 		return nil, err
 	}
+	handler.tsServer = server
+	handler.logger = logger
+	if args.Acl != "" {
+		policy, err := LoadAclPolicy(args.Acl)
+		if err != nil {
+			return nil, fmt.Errorf("loading acl policy: %w", err)
+		}
+		handler.acl = policy
+	}
+
+	uploadStateDir := args.StateDir
+	if uploadStateDir == "" {
+		uploadStateDir = filepath.Join(os.TempDir(), "ts-fileserver-"+args.Name)
+	}
+	tusHandler, err := NewTusHandler(handler.backend, uploadStateDir, args.Writable)
+	if err != nil {
+		return nil, err
+	}
 
-	return &app{
-		ctx:     ctx,
-		cancel:  cancel,
-		handler: handler,
-		root:    args.Root,
-		server:  server,
-		funnel:  args.Funnel,
-	}, nil
+	a := &app{
+		ctx:        ctx,
+		cancel:     cancel,
+		handler:    handler,
+		root:       args.Root,
+		server:     server,
+		funnel:     args.Funnel,
+		tusHandler: tusHandler,
+		logger:     logger,
+	}
+	if args.Dav {
+		davHandler, err := newDavHandler(handler)
+		if err != nil {
+			return nil, fmt.Errorf("enabling webdav: %w", err)
+		}
+		a.davHandler = davHandler
+	}
+	return a, nil
 }
 
 func (a *app) Close() {
@@ -77,7 +122,7 @@ func (a *app) Close() {
 }
 
 func (a *app) Run() error {
-	log.Printf("Starting file server on %s", a.handler.Root())
+	a.logger.Info("starting file server", "root", a.handler.Root())
 	defer a.cancel()
 	var ln net.Listener
 	var err error
@@ -91,18 +136,47 @@ func (a *app) Run() error {
 		}
 	}
 	for _, domain := range a.server.CertDomains() {
-		log.Printf("To use it please access: https://%s", domain)
+		a.logger.Info("certificate available", "url", "https://"+domain)
 	}
-	httpServer := http.Server{Handler: a.handler}
-	if err := httpServer.Serve(ln); err != nil {
-		return err
+	mux := http.NewServeMux()
+	mux.Handle("/", a.handler)
+	mux.Handle("/uploads/", aclGuard(a.handler, tusWritingMethods, a.tusHandler))
+	mux.Handle("/metrics", aclGuard(a.handler, nil, promhttp.Handler()))
+	if a.davHandler != nil {
+		a.logger.Info("webdav mounted", "path", "/dav/")
+		mux.Handle("/dav/", aclGuard(a.handler, davMethodsWriting, a.davHandler))
+	}
+	httpServer := &http.Server{Handler: loggingMiddleware(a.logger, a.handler, mux)}
+
+	ctx, stop := signal.NotifyContext(a.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		a.logger.Info("shutting down, waiting for in-flight requests")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
 	}
-	return nil
 }
 
 type FileServer struct {
-	root     string
+	backend  Backend
+	display  string
 	writable bool
+	acl      *AclPolicy
+	tsServer *tsnet.Server
+	logger   *slog.Logger
 }
 
 const HTML_PRELUDE = `
@@ -118,21 +192,42 @@ const HTML_PRELUDE = `
 <body>
 
 <script>
+const TUS_RESUMABLE = "1.0.0"
+const TUS_CHUNK_SIZE = 4 * 1024 * 1024
+
+async function uploadFile(file) {
+	const metadata = "filename " + btoa(unescape(encodeURIComponent(file.name)))
+	const created = await fetch("/uploads/", {
+		method: "POST",
+		headers: {
+			"Tus-Resumable": TUS_RESUMABLE,
+			"Upload-Length": String(file.size),
+			"Upload-Metadata": metadata,
+		},
+	})
+	const location = created.headers.get("Location")
+	let offset = 0
+	while (offset < file.size) {
+		const chunk = file.slice(offset, offset + TUS_CHUNK_SIZE)
+		const patched = await fetch(location, {
+			method: "PATCH",
+			headers: {
+				"Tus-Resumable": TUS_RESUMABLE,
+				"Upload-Offset": String(offset),
+				"Content-Type": "application/offset+octet-stream",
+			},
+			body: chunk,
+		})
+		offset = Number(patched.headers.get("Upload-Offset"))
+		document.getElementById("status").innerText = (file.name + ": " + ((offset / file.size) * 100).toFixed(2) + "%")
+	}
+}
+
 async function upload() {
 	const input = document.getElementById("file")
 	for (const file of input.files) {
-	    const {name} = file
-	    const url = window.location.toString() + "/" + name
-	    const xhr = new XMLHttpRequest()
-	    xhr.open('POST', url, true)
-	    xhr.upload.onprogress = function(event) {
-	      if (event.lengthComputable) {
-	          const percentComplete = (event.loaded / event.total) * 100;
-	          document.getElementById("status").innerText = (name + ": " + percentComplete.toFixed(2) + "%");
-	      }
-		};
 	    console.log(file)
-	    xhr.send(file)
+	    await uploadFile(file)
 	}
 	document.getElementById("status").innerText = "Finished"
 }
@@ -149,45 +244,61 @@ func (f *FileServer) WriteHTMLPrelude(w io.Writer) {
 
 // ServeHTTP implements http.Handler.
 func (f *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("%s %s %s", r.Method, r.RemoteAddr, r.URL.Path)
-
-	item := path.Join(f.root, r.URL.Path)
-	if !strings.HasPrefix(item, f.root) {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "nice try!")
+	needed := permRead
+	if r.Method == http.MethodPost {
+		needed = permWrite
+	}
+	if !f.authorize(r, needed) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "you don't have permission to do that")
 		return
 	}
 	if r.Method == http.MethodGet {
-		info, err := os.Stat(item)
+		info, err := f.backend.Stat(r.URL.Path)
+		if errors.Is(err, ErrPathTraversal) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "nice try!")
+			return
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "can't stat item: %s", err.Error())
 			return
 		}
 		if info.IsDir() {
-			entries, err := os.ReadDir(item)
+			if format := requestedArchiveFormat(r); format != archiveNone {
+				dir, ok := f.localDir()
+				if !ok {
+					w.WriteHeader(http.StatusNotImplemented)
+					fmt.Fprintf(w, "archive downloads need a local backend")
+					return
+				}
+				item := filepath.Join(dir, filepath.FromSlash(r.URL.Path))
+				if err := writeArchive(w, dir, item, info.Name(), format); err != nil {
+					f.logger.Error("can't stream archive", "path", r.URL.Path, "error", err)
+				}
+				return
+			}
+			entries, err := f.backend.ReadDir(r.URL.Path)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "can't list folder entries: %s", err.Error())
 				return
 			}
 			f.WriteHTMLPrelude(w)
-			fmt.Fprintf(w, "<h1>Files in %s</h1>", item)
+			fmt.Fprintf(w, "<h1>Files in %s</h1>", r.URL.Path)
 			for _, entry := range entries {
 				fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>", r.URL.JoinPath(entry.Name()), entry.Name())
 			}
 		} else {
-			f, err := os.Open(item)
+			file, err := f.backend.Open(r.URL.Path)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "can't open file to be read: %s", err.Error())
 				return
 			}
-			w.Header().Add("Content-Length", fmt.Sprintf("%d", info.Size()))
-			w.Header().Add("Content-Type", "application/octet-stream")
-			defer f.Close()
-			buf := make([]byte, 1024*1024)
-			io.CopyBuffer(w, f, buf)
+			defer file.Close()
+			http.ServeContent(w, r, info.Name(), info.ModTime(), file)
 		}
 	}
 	if r.Method == http.MethodPost && !f.writable {
@@ -196,45 +307,154 @@ func (f *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method == http.MethodPost {
-		info, err := os.Stat(item)
-		if info != nil && info.IsDir() {
+		if info, err := f.backend.Stat(r.URL.Path); err == nil && info.IsDir() {
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "path should not be a existing folder")
 			return
 		}
-		if err := os.MkdirAll(path.Dir(item), os.ModePerm); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "can't create parent directory: %s", err.Error())
-			return
-		}
-		f, err := os.Create(item)
-		defer f.Close()
+		file, err := f.backend.Create(r.URL.Path)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "can't create file: %s", err.Error())
+			return
 		}
+		defer file.Close()
 		buf := make([]byte, 1024*1024)
-		io.CopyBuffer(f, r.Body, buf)
-
+		io.CopyBuffer(file, r.Body, buf)
 	}
-
 }
 
 func (f *FileServer) Root() string {
-	return f.root
+	return f.display
 }
 
-func NewFileServer(root string, writable bool) (*FileServer, error) {
-	root, err := filepath.Abs(root)
+// localDir returns the backend's root directory on disk, if it has one.
+// Archive downloads and WebDAV currently require a local backend.
+func (f *FileServer) localDir() (string, bool) {
+	rooted, ok := f.backend.(LocalRooted)
+	if !ok {
+		return "", false
+	}
+	return rooted.LocalDir(), true
+}
+
+// resolvePrincipals resolves the calling Tailscale identity for r into the
+// set of principals an AclPolicy can match against: the user's login name
+// and any tags on the calling node. Requests with no resolvable identity
+// (e.g. Funnel traffic) get the policy's FunnelAnonymous principal, if one
+// is configured.
+func (f *FileServer) resolvePrincipals(r *http.Request) []string {
+	if f.tsServer == nil {
+		return nil
+	}
+	lc, err := f.tsServer.LocalClient()
 	if err != nil {
-		return nil, err
+		return nil
+	}
+	who, err := lc.WhoIs(r.Context(), r.RemoteAddr)
+	if err != nil || who == nil {
+		if f.acl != nil && f.acl.FunnelAnonymous != "" {
+			return []string{f.acl.FunnelAnonymous}
+		}
+		return nil
+	}
+	var principals []string
+	if who.UserProfile != nil && who.UserProfile.LoginName != "" {
+		principals = append(principals, who.UserProfile.LoginName)
 	}
-	rootInfo, err := os.Stat(root)
+	if who.Node != nil {
+		principals = append(principals, who.Node.Tags...)
+	}
+	return principals
+}
+
+func principalLabel(principals []string) string {
+	if len(principals) == 0 {
+		return "anonymous"
+	}
+	return strings.Join(principals, ",")
+}
+
+// authorize reports whether r's caller holds at least needed permission on
+// r.URL.Path under f's ACL policy. Requests are always allowed when no
+// policy is configured.
+func (f *FileServer) authorize(r *http.Request, needed permission) bool {
+	if f.acl == nil {
+		return true
+	}
+	return f.acl.Allows(r.URL.Path, f.resolvePrincipals(r)) >= needed
+}
+
+// aclGuard wraps next so every request is run through f's ACL policy
+// before reaching it, the same way FileServer.ServeHTTP gates the main
+// handler. writingMethods marks which HTTP methods need permWrite rather
+// than permRead; this lets /dav/ and /uploads/ share the same policy
+// instead of only being gated by the global -w flag.
+func aclGuard(f *FileServer, writingMethods map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		needed := permRead
+		if writingMethods[r.Method] {
+			needed = permWrite
+		}
+		if !f.authorize(r, needed) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "you don't have permission to do that")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// davMethodsWriting are the WebDAV methods that mutate the filesystem and
+// therefore require params.Writable.
+var davMethodsWriting = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	"MKCOL":           true,
+	"MOVE":            true,
+	"COPY":            true,
+	"PROPPATCH":       true,
+}
+
+// newDavHandler mounts a WebDAV server over f's root, reusing the same
+// path-traversal guard and write gating as the HTML browser. It requires a
+// local backend, since golang.org/x/net/webdav only speaks to one.
+func newDavHandler(f *FileServer) (http.Handler, error) {
+	dir, ok := f.localDir()
+	if !ok {
+		return nil, fmt.Errorf("webdav requires a local backend, got %T", f.backend)
+	}
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(dir),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				f.logger.Error("webdav request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/dav")
+		item := path.Join(dir, rest)
+		if !withinRoot(dir, item) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "nice try!")
+			return
+		}
+		if !f.writable && davMethodsWriting[r.Method] {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "i'm afraid i can't do that")
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}), nil
+}
+
+func NewFileServer(root string, writable bool) (*FileServer, error) {
+	backend, display, err := newBackend(root)
 	if err != nil {
 		return nil, err
 	}
-	if !rootInfo.IsDir() {
-		return nil, ErrNotADir
-	}
-	return &FileServer{root: root, writable: writable}, nil
+	return &FileServer{backend: backend, display: display, writable: writable, logger: slog.Default()}, nil
 }
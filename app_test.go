@@ -0,0 +1,37 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeHTTPRange(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("0123456789abcdef")
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileServer(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/file.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	f.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusPartialContent)
+	}
+	if got, want := rec.Body.String(), string(content[2:6]); got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Range"), fmt.Sprintf("bytes 2-5/%d", len(content)); got != want {
+		t.Fatalf("Content-Range = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package fileserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveFormat is a whole-directory download format negotiated via the
+// Accept header or a ?format= query parameter.
+type archiveFormat string
+
+const (
+	archiveNone  archiveFormat = ""
+	archiveZip   archiveFormat = "zip"
+	archiveTar   archiveFormat = "tar"
+	archiveTarGz archiveFormat = "tar.gz"
+)
+
+// requestedArchiveFormat inspects r to decide whether the caller wants a
+// directory streamed as an archive instead of the HTML index.
+func requestedArchiveFormat(r *http.Request) archiveFormat {
+	switch r.URL.Query().Get("format") {
+	case "zip":
+		return archiveZip
+	case "tar":
+		return archiveTar
+	case "tar.gz", "tgz":
+		return archiveTarGz
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/zip"):
+		return archiveZip
+	case strings.Contains(accept, "application/gzip"), strings.Contains(accept, "application/x-gzip"):
+		return archiveTarGz
+	case strings.Contains(accept, "application/x-tar"):
+		return archiveTar
+	}
+	return archiveNone
+}
+
+// writeArchive walks dir, an absolute path under root, and streams it to w
+// as a zip or tar(.gz) archive named after name, skipping symlinks that
+// resolve outside of root.
+func writeArchive(w http.ResponseWriter, root, dir, name string, format archiveFormat) error {
+	var ext, contentType string
+	switch format {
+	case archiveZip:
+		ext, contentType = "zip", "application/zip"
+	case archiveTar:
+		ext, contentType = "tar", "application/x-tar"
+	case archiveTarGz:
+		ext, contentType = "tar.gz", "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+ext))
+
+	switch format {
+	case archiveZip:
+		zw := zip.NewWriter(w)
+		defer zw.Close()
+		return walkArchive(root, dir, func(relPath string, info fs.FileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			entry, err := zw.Create(relPath)
+			if err != nil {
+				return err
+			}
+			return copyFileInto(entry, filepath.Join(dir, relPath))
+		})
+	default:
+		out := io.Writer(w)
+		if format == archiveTarGz {
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		tw := tar.NewWriter(out)
+		defer tw.Close()
+		return walkArchive(root, dir, func(relPath string, info fs.FileInfo) error {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = relPath
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return copyFileInto(tw, filepath.Join(dir, relPath))
+		})
+	}
+}
+
+// withinRoot reports whether target is root itself or a descendant of it.
+// A bare strings.HasPrefix(target, root) would wrongly accept a sibling
+// like root "/srv/share" matching target "/srv/share-backup/secret.txt";
+// comparing the filepath.Rel result instead requires an actual path
+// separator between them.
+func withinRoot(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// walkArchive visits every entry under dir (excluding dir itself), calling
+// visit with a slash-separated path relative to dir. Symlinks that resolve
+// outside of root are skipped rather than followed.
+func walkArchive(root, dir string, visit func(relPath string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		var info fs.FileInfo
+		if d.Type()&os.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil || !withinRoot(root, target) {
+				return nil
+			}
+			// Dereference so tar/zip entries carry the target's real
+			// content and mode instead of a dangling symlink header.
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		} else {
+			if info, err = d.Info(); err != nil {
+				return err
+			}
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return visit(filepath.ToSlash(rel), info)
+	})
+}
+
+func copyFileInto(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := make([]byte, 1024*1024)
+	_, err = io.CopyBuffer(w, file, buf)
+	return err
+}
@@ -0,0 +1,53 @@
+package fileserver
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// ReadSeekCloser is what Backend.Open returns; it's the minimum surface
+// http.ServeContent needs to answer Range requests.
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// Backend abstracts the storage FileServer serves files from, so Root
+// isn't restricted to a local directory. name is always a slash-separated
+// path relative to the backend's root; implementations are responsible for
+// guarding against it escaping that root.
+type Backend interface {
+	Stat(name string) (fs.FileInfo, error)
+	Open(name string) (ReadSeekCloser, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Create(name string) (io.WriteCloser, error)
+	MkdirAll(name string) error
+	Remove(name string) error
+}
+
+// LocalRooted is implemented by backends backed by a literal directory on
+// disk. WebDAV and archive downloads need one today.
+type LocalRooted interface {
+	LocalDir() string
+}
+
+// newBackend selects a Backend from a -r/Root value: a
+// "s3://bucket/prefix?endpoint=..." URL picks the S3 backend, anything
+// else is treated as a local directory. It returns the backend along with
+// a human-readable description of it for logging.
+func newBackend(root string) (Backend, string, error) {
+	if strings.HasPrefix(root, "s3://") {
+		backend, err := ParseS3Root(root)
+		if err != nil {
+			return nil, "", err
+		}
+		return backend, root, nil
+	}
+	backend, err := NewLocalBackend(root)
+	if err != nil {
+		return nil, "", err
+	}
+	return backend, backend.LocalDir(), nil
+}
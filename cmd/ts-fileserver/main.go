@@ -11,11 +11,13 @@ import (
 func main() {
 	var params fileserver.AppParams
 
-	flag.StringVar(&params.Root, "r", ".", "Which folder to expose")
+	flag.StringVar(&params.Root, "r", ".", "Which folder to expose, or a s3://bucket/prefix?endpoint=... URL to serve from S3-compatible storage")
 	flag.StringVar(&params.StateDir, "s", "", "Where to store Tailscale state")
 	flag.StringVar(&params.Name, "n", "ts-fileserver", "Hostname of this Tailscale node")
 	flag.BoolVar(&params.Funnel, "f", false, "Expose it to the Internet?")
 	flag.BoolVar(&params.Writable, "w", false, "Are users able to write files?")
+	flag.BoolVar(&params.Dav, "dav", false, "Mount a WebDAV server on /dav/ alongside the HTML browser")
+	flag.StringVar(&params.Acl, "acl", "", "Path to a YAML or JSON ACL policy (by extension, default JSON) mapping Tailscale identities to read/write permissions")
 	flag.Parse()
 
 	spew.Dump("args: ", params)
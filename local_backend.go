@@ -0,0 +1,95 @@
+package fileserver
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalBackend serves files from a directory on the local filesystem.
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend resolves root to an absolute path and returns a Backend
+// backed by it.
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrNotADir
+	}
+	return &LocalBackend{root: root}, nil
+}
+
+// LocalDir implements LocalRooted.
+func (b *LocalBackend) LocalDir() string {
+	return b.root
+}
+
+func (b *LocalBackend) resolve(name string) (string, error) {
+	item := path.Join(b.root, name)
+	if !withinRoot(b.root, item) {
+		return "", ErrPathTraversal
+	}
+	return item, nil
+}
+
+func (b *LocalBackend) Stat(name string) (fs.FileInfo, error) {
+	item, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(item)
+}
+
+func (b *LocalBackend) Open(name string) (ReadSeekCloser, error) {
+	item, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(item)
+}
+
+func (b *LocalBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	item, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(item)
+}
+
+func (b *LocalBackend) Create(name string) (io.WriteCloser, error) {
+	item, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(path.Dir(item), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.Create(item)
+}
+
+func (b *LocalBackend) MkdirAll(name string) error {
+	item, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(item, os.ModePerm)
+}
+
+func (b *LocalBackend) Remove(name string) error {
+	item, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(item)
+}
@@ -0,0 +1,28 @@
+package fileserver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Total HTTP requests served, by method and status code.",
+	}, []string{"method", "status"})
+
+	bytesSentTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bytes_sent_total",
+		Help: "Total bytes written to response bodies.",
+	})
+
+	bytesReceivedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bytes_received_total",
+		Help: "Total bytes read from request bodies.",
+	})
+
+	uploadInflight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "upload_inflight",
+		Help: "Number of uploads currently being received.",
+	})
+)
@@ -0,0 +1,82 @@
+package fileserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusRecorder wraps http.ResponseWriter to capture the status code and
+// byte count written, for access logging and metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// countingBody wraps a request body to count bytes read from it.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// loggingMiddleware wraps next with structured access logging and
+// Prometheus metrics: requests_total, bytes_sent_total,
+// bytes_received_total, and upload_inflight while a write is in progress.
+func loggingMiddleware(logger *slog.Logger, identity *FileServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			uploadInflight.Inc()
+			defer uploadInflight.Dec()
+		}
+
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestsTotal.WithLabelValues(r.Method, strconv.Itoa(status)).Inc()
+		bytesSentTotal.Add(float64(rec.bytes))
+		bytesReceivedTotal.Add(float64(body.n))
+
+		logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes_sent", rec.bytes,
+			"bytes_received", body.n,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+			"identity", principalLabel(identity.resolvePrincipals(r)),
+		)
+	})
+}
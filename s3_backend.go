@@ -0,0 +1,173 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Backend serves files from an S3-compatible object store, selected by
+// passing a "s3://bucket/prefix?endpoint=..." URL as the -r/Root value.
+type S3Backend struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// ParseS3Root parses a "s3://bucket/prefix?endpoint=host[&secure=false]"
+// URL into an S3Backend. Credentials come from the environment the same
+// way the AWS CLI reads them (AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY).
+func ParseS3Root(raw string) (*S3Backend, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: u.Query().Get("secure") != "false",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{
+		client: client,
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (b *S3Backend) key(name string) string {
+	return path.Join(b.prefix, path.Clean("/"+name))
+}
+
+// s3FileInfo is a minimal fs.FileInfo backing Stat/ReadDir results, since
+// object storage has no native inode to ask.
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i s3FileInfo) Name() string { return i.name }
+func (i s3FileInfo) Size() int64  { return i.size }
+func (i s3FileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+func (i s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i s3FileInfo) IsDir() bool        { return i.isDir }
+func (i s3FileInfo) Sys() any           { return nil }
+
+func (b *S3Backend) Stat(name string) (fs.FileInfo, error) {
+	key := b.key(name)
+	ctx := context.Background()
+	info, err := b.client.StatObject(ctx, b.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return s3FileInfo{name: path.Base(name), size: info.Size, modTime: info.LastModified}, nil
+	}
+	// Object storage has no real directories: treat name as one if
+	// anything exists under it as a prefix.
+	prefix := key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: prefix, MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		return s3FileInfo{name: path.Base(name), isDir: true}, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (b *S3Backend) Open(name string) (ReadSeekCloser, error) {
+	return b.client.GetObject(context.Background(), b.bucket, b.key(name), minio.GetObjectOptions{})
+}
+
+func (b *S3Backend) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := b.key(name)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var entries []fs.DirEntry
+	for obj := range b.client.ListObjects(context.Background(), b.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		rel := strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/")
+		if rel == "" {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(s3FileInfo{
+			name:    rel,
+			size:    obj.Size,
+			modTime: obj.LastModified,
+			isDir:   strings.HasSuffix(obj.Key, "/"),
+		}))
+	}
+	return entries, nil
+}
+
+// s3WriteCloser streams writes straight into a PutObject call through an
+// io.Pipe, so an upload never has to fit in memory: passing size -1 makes
+// minio-go switch to multipart upload automatically.
+type s3WriteCloser struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3WriteCloser) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3WriteCloser) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+func (b *S3Backend) Create(name string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.client.PutObject(context.Background(), b.bucket, b.key(name), pr, -1, minio.PutObjectOptions{})
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return &s3WriteCloser{pw: pw, done: done}, nil
+}
+
+// MkdirAll writes a zero-byte, trailing-slash marker object, the common
+// convention object stores use to represent an (otherwise nonexistent)
+// directory.
+func (b *S3Backend) MkdirAll(name string) error {
+	key := b.key(name)
+	if key == "" {
+		return nil
+	}
+	if !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	_, err := b.client.PutObject(context.Background(), b.bucket, key, bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	return err
+}
+
+func (b *S3Backend) Remove(name string) error {
+	return b.client.RemoveObject(context.Background(), b.bucket, b.key(name), minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,276 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const tusResumableVersion = "1.0.0"
+
+// tusWritingMethods are the tus methods that create or mutate upload data,
+// as opposed to status checks, and therefore need permWrite under an ACL
+// policy.
+var tusWritingMethods = map[string]bool{
+	http.MethodPost:  true,
+	http.MethodPatch: true,
+}
+
+// tusUpload tracks the state of one in-progress resumable upload.
+type tusUpload struct {
+	ID       string `json:"id"`
+	Length   int64  `json:"length"`
+	Offset   int64  `json:"offset"`
+	Filename string `json:"filename"`
+}
+
+// TusHandler implements the tus.io 1.0 resumable upload protocol
+// (https://tus.io/protocols/resumable-upload) on whatever path it's
+// mounted at. Partial uploads are kept in uploadDir until complete, then
+// copied into backend.
+type TusHandler struct {
+	backend   Backend
+	uploadDir string
+	writable  bool
+
+	mu      sync.Mutex
+	uploads map[string]*tusUpload
+}
+
+// NewTusHandler creates a TusHandler that finalizes uploads into backend,
+// keeping partial state under <stateDir>/uploads.
+func NewTusHandler(backend Backend, stateDir string, writable bool) (*TusHandler, error) {
+	uploadDir := filepath.Join(stateDir, "uploads")
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return nil, err
+	}
+	return &TusHandler{
+		backend:   backend,
+		uploadDir: uploadDir,
+		writable:  writable,
+		uploads:   make(map[string]*tusUpload),
+	}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (t *TusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	if !t.writable {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "i'm afraid i can't do that")
+		return
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Tus-Version", tusResumableVersion)
+		w.Header().Set("Tus-Extension", "creation")
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		t.create(w, r)
+	case http.MethodHead:
+		t.status(w, r)
+	case http.MethodPatch:
+		t.patch(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *TusHandler) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "missing or invalid Upload-Length")
+		return
+	}
+	id, err := newUploadID()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't allocate upload id: %s", err.Error())
+		return
+	}
+	upload := &tusUpload{ID: id, Length: length, Filename: filenameFromMetadata(r.Header.Get("Upload-Metadata"))}
+	if upload.Filename == "" {
+		upload.Filename = id
+	}
+	if _, err := os.OpenFile(t.dataPath(id), os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't start upload: %s", err.Error())
+		return
+	}
+	if err := t.save(upload); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't start upload: %s", err.Error())
+		return
+	}
+	t.mu.Lock()
+	t.uploads[id] = upload
+	t.mu.Unlock()
+
+	w.Header().Set("Location", path.Join(r.URL.Path, id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (t *TusHandler) status(w http.ResponseWriter, r *http.Request) {
+	upload, err := t.lookup(idFromPath(r.URL.Path))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (t *TusHandler) patch(w http.ResponseWriter, r *http.Request) {
+	id := idFromPath(r.URL.Path)
+	upload, err := t.lookup(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "Upload-Offset does not match current offset %d", upload.Offset)
+		return
+	}
+	file, err := os.OpenFile(t.dataPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't open upload: %s", err.Error())
+		return
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't seek upload: %s", err.Error())
+		return
+	}
+	written, err := io.Copy(file, r.Body)
+	upload.Offset += written
+	if saveErr := t.save(upload); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "can't write upload: %s", err.Error())
+		return
+	}
+	if upload.Offset >= upload.Length {
+		if err := t.complete(upload); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "can't finalize upload: %s", err.Error())
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete copies a fully-received upload from uploadDir into the backend
+// under its final name, then cleans up the partial state.
+func (t *TusHandler) complete(upload *tusUpload) error {
+	src, err := os.Open(t.dataPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := t.backend.Create(upload.Filename)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	if _, err := io.Copy(dest, src); err != nil {
+		return err
+	}
+	os.Remove(t.dataPath(upload.ID))
+	os.Remove(t.infoPath(upload.ID))
+	t.mu.Lock()
+	delete(t.uploads, upload.ID)
+	t.mu.Unlock()
+	return nil
+}
+
+// lookup returns the tracked state for id, recovering it from its sidecar
+// info file if the process restarted since the upload was created.
+func (t *TusHandler) lookup(id string) (*tusUpload, error) {
+	if id == "" {
+		return nil, os.ErrNotExist
+	}
+	t.mu.Lock()
+	upload, ok := t.uploads[id]
+	t.mu.Unlock()
+	if ok {
+		return upload, nil
+	}
+	data, err := os.ReadFile(t.infoPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var loaded tusUpload
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.uploads[id] = &loaded
+	t.mu.Unlock()
+	return &loaded, nil
+}
+
+func (t *TusHandler) save(upload *tusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.infoPath(upload.ID), data, 0600)
+}
+
+func (t *TusHandler) dataPath(id string) string {
+	return filepath.Join(t.uploadDir, id)
+}
+
+func (t *TusHandler) infoPath(id string) string {
+	return filepath.Join(t.uploadDir, id+".info")
+}
+
+func idFromPath(urlPath string) string {
+	return path.Base(strings.TrimSuffix(urlPath, "/"))
+}
+
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// filenameFromMetadata extracts the "filename" key out of a tus
+// Upload-Metadata header, whose values are comma-separated
+// "key base64(value)" pairs.
+func filenameFromMetadata(header string) string {
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(strings.TrimSpace(pair))
+		if len(fields) != 2 || fields[0] != "filename" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			continue
+		}
+		return string(decoded)
+	}
+	return ""
+}